@@ -0,0 +1,441 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/option"
+)
+
+// Report is the structured performance report produced by any Analyzer
+// implementation. Its shape is the contract the frontend renders against,
+// so every provider is responsible for coaxing its model into exactly
+// this JSON, regardless of how it gets there internally.
+type Report struct {
+	PlayerInfo struct {
+		JerseyNumber string `json:"jersey_number"`
+		Position     string `json:"position"`
+		Team         string `json:"team"`
+	} `json:"player_info"`
+	Summary       string `json:"summary"`
+	KeyHighlights []struct {
+		TimestampSeconds float64 `json:"timestamp_seconds"`
+		Title            string  `json:"title"`
+		Description      string  `json:"description"`
+	} `json:"key_highlights"`
+	Timeline []struct {
+		TimestampSeconds float64 `json:"timestamp_seconds"`
+		Moment           string  `json:"moment"`
+	} `json:"timeline"`
+	PerformanceRating string `json:"performance_rating"`
+}
+
+// Analyzer produces a performance Report for an uploaded video. Each
+// implementation is free to use whatever model or pipeline it likes, as
+// long as it returns valid JSON matching Report.
+type Analyzer interface {
+	Analyze(ctx context.Context, videoPath string, prompt string) (*Report, error)
+}
+
+// NewAnalyzer selects an Analyzer implementation based on the ANALYZER
+// environment variable (gemini|openai|local), defaulting to gemini so
+// existing deployments keep working unchanged.
+func NewAnalyzer(apiKey string) (Analyzer, error) {
+	switch strings.ToLower(os.Getenv("ANALYZER")) {
+	case "", "gemini":
+		return &GeminiAnalyzer{apiKey: apiKey}, nil
+	case "openai":
+		return &ChatCompletionAnalyzer{
+			baseURL:            envOrDefault("OPENAI_BASE_URL", "https://api.openai.com/v1"),
+			apiKey:             os.Getenv("OPENAI_API_KEY"),
+			model:              envOrDefault("OPENAI_MODEL", "gpt-4o-mini"),
+			transcriptionModel: envOrDefault("OPENAI_TRANSCRIPTION_MODEL", "whisper-1"),
+		}, nil
+	case "local":
+		return &ChatCompletionAnalyzer{
+			baseURL:            envOrDefault("LOCAL_ANALYZER_URL", "http://localhost:8000/v1"),
+			apiKey:             os.Getenv("LOCAL_ANALYZER_API_KEY"),
+			model:              envOrDefault("LOCAL_ANALYZER_MODEL", "local-vlm"),
+			transcriptionModel: envOrDefault("LOCAL_TRANSCRIPTION_MODEL", "whisper-1"),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown ANALYZER %q: want gemini, openai, or local", os.Getenv("ANALYZER"))
+	}
+}
+
+func envOrDefault(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+const analyzerSystemPrompt = `You are a professional sports video analyst specializing in player performance analysis.
+
+CRITICAL: This video is likely a player highlight reel. Your PRIMARY task is to:
+1. Identify which player is the main focus (by frequency of appearance, jersey number, camera focus)
+2. Generate a structured performance report for that player
+
+Return your response as a valid JSON object with this structure:
+{
+  "player_info": {
+    "jersey_number": "<jersey number if visible>",
+    "position": "<detected position based on play style>",
+    "team": "<team name if visible>"
+  },
+  "summary": "<2-3 paragraph narrative summary of the player's overall performance in this video. Write in a professional sports analyst style, discussing their key contributions, playing style, and standout moments.>",
+  "key_highlights": [
+    {
+      "timestamp_seconds": <number>,
+      "title": "<brief title>",
+      "description": "<1-2 sentence description>"
+    }
+  ],
+  "timeline": [
+    {
+      "timestamp_seconds": <number>,
+      "moment": "<brief description of what happens>"
+    }
+  ],
+  "performance_rating": "<rating from 1-10 with brief justification>"
+}
+
+Guidelines:
+- key_highlights: Include ONLY 3-5 of the MOST important moments (these will have screenshots)
+- timeline: Include ALL notable moments with timestamps for reference (10-15 items)
+- summary: Write like a professional sports journalist, flowing narrative not bullet points
+- Mention jersey numbers when identifying players
+- Focus on the main player throughout
+
+Important:
+- Return ONLY the JSON object, no additional text
+- All timestamp_seconds must be numbers (not strings)`
+
+// analyzerUserPrompt builds the user-turn prompt. transcript is optional
+// (the Gemini path sends the video directly and has no use for it); when
+// present it's appended so providers working from extracted frames alone
+// still get what was said on commentary/sideline audio.
+func analyzerUserPrompt(customPrompt string, transcript string) string {
+	base := "Analyze this sports highlight video and generate a comprehensive performance report. Identify the main player being showcased and provide a narrative summary, 3-5 key highlights for screenshots, and a full timeline of moments."
+	if customPrompt != "" {
+		base = fmt.Sprintf("Analyze this sports video focusing on: '%s'. Generate a comprehensive performance report with summary, key highlights (3-5), and timeline.", customPrompt)
+	}
+	if transcript != "" {
+		base += fmt.Sprintf("\n\nAudio transcript of the video:\n%s", transcript)
+	}
+	return base
+}
+
+// GeminiAnalyzer uploads the video to the Gemini Files API and generates
+// the report by asking for application/json output and parsing the
+// model's text response. This is the original analysis path, now behind
+// the Analyzer interface.
+type GeminiAnalyzer struct {
+	apiKey string
+}
+
+func (a *GeminiAnalyzer) Analyze(ctx context.Context, videoPath string, prompt string) (*Report, error) {
+	client, err := genai.NewClient(ctx, option.WithAPIKey(a.apiKey))
+	if err != nil {
+		return nil, fmt.Errorf("error creating Gemini client: %w", err)
+	}
+	defer client.Close()
+
+	f, err := os.Open(videoPath)
+	if err != nil {
+		return nil, fmt.Errorf("error opening video: %w", err)
+	}
+	defer f.Close()
+
+	uploadFile, err := client.UploadFile(ctx, "", f, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error uploading to Gemini: %w", err)
+	}
+
+	for uploadFile.State == genai.FileStateProcessing {
+		time.Sleep(2 * time.Second)
+		uploadFile, err = client.GetFile(ctx, uploadFile.Name)
+		if err != nil {
+			return nil, fmt.Errorf("error checking file state: %w", err)
+		}
+	}
+	if uploadFile.State != genai.FileStateActive {
+		return nil, fmt.Errorf("file processing failed. State: %s", uploadFile.State)
+	}
+	defer client.DeleteFile(ctx, uploadFile.Name)
+
+	model := client.GenerativeModel("gemini-3-flash-preview")
+	model.ResponseMIMEType = "application/json"
+	model.SystemInstruction = genai.NewUserContent(genai.Text(analyzerSystemPrompt))
+
+	resp, err := model.GenerateContent(ctx, genai.Text(analyzerUserPrompt(prompt, "")), genai.FileData{URI: uploadFile.URI})
+	if err != nil {
+		return nil, fmt.Errorf("error generating content: %w", err)
+	}
+	if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
+		return nil, fmt.Errorf("no content generated")
+	}
+
+	var jsonResponse string
+	for _, part := range resp.Candidates[0].Content.Parts {
+		if txt, ok := part.(genai.Text); ok {
+			jsonResponse += string(txt)
+		}
+	}
+
+	return parseReport(jsonResponse)
+}
+
+// ChatCompletionAnalyzer backs the "openai" and "local" providers: it
+// extracts keyframes at scene-change boundaries with ffmpeg, transcribes
+// the audio track, and sends both (plus the prompt) to any OpenAI-compatible
+// chat/completions endpoint, retrying once with a repair prompt if the
+// model's JSON doesn't parse. This is what lets self-hosters point
+// ANALYZER=local at their own VLM server and run fully offline.
+type ChatCompletionAnalyzer struct {
+	baseURL            string
+	apiKey             string
+	model              string
+	transcriptionModel string
+}
+
+func (a *ChatCompletionAnalyzer) Analyze(ctx context.Context, videoPath string, prompt string) (*Report, error) {
+	frames, err := extractSceneChangeFrames(ctx, videoPath)
+	if err != nil {
+		return nil, fmt.Errorf("error extracting keyframes: %w", err)
+	}
+	if len(frames) == 0 {
+		return nil, fmt.Errorf("no scene-change frames extracted")
+	}
+
+	transcript, err := a.transcribeAudio(ctx, videoPath)
+	if err != nil {
+		// The video may have no usable audio track; that shouldn't sink the
+		// whole analysis, so fall back to frames-only.
+		log.Printf("Audio transcription failed, continuing without it: %v", err)
+		transcript = ""
+	}
+
+	jsonResponse, err := a.chatCompletion(ctx, frames, analyzerUserPrompt(prompt, transcript))
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := parseReport(jsonResponse)
+	if err != nil {
+		// Retry once with a repair prompt asking the model to fix its own JSON.
+		repaired, repairErr := a.chatCompletion(ctx, nil, fmt.Sprintf(
+			"Your previous response was not valid JSON matching the required schema. "+
+				"Fix and return ONLY the corrected JSON object. Previous response:\n%s", jsonResponse))
+		if repairErr != nil {
+			return nil, fmt.Errorf("invalid JSON and repair failed: %w", err)
+		}
+		return parseReport(repaired)
+	}
+	return report, nil
+}
+
+// chatCompletion sends the system prompt, user prompt, and any base64
+// keyframes to the configured OpenAI-compatible endpoint and returns the
+// assistant's raw text content.
+func (a *ChatCompletionAnalyzer) chatCompletion(ctx context.Context, frames []string, userPrompt string) (string, error) {
+	content := []map[string]interface{}{
+		{"type": "text", "text": userPrompt},
+	}
+	for _, frame := range frames {
+		content = append(content, map[string]interface{}{
+			"type": "image_url",
+			"image_url": map[string]string{
+				"url": "data:image/jpeg;base64," + frame,
+			},
+		})
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"model": a.model,
+		"messages": []map[string]interface{}{
+			{"role": "system", "content": analyzerSystemPrompt},
+			{"role": "user", "content": content},
+		},
+		"response_format": map[string]string{"type": "json_object"},
+	})
+	if err != nil {
+		return "", fmt.Errorf("error encoding request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.baseURL+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("error building request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if a.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+a.apiKey)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error calling chat completions endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var parsed struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return "", fmt.Errorf("error decoding response: %w", err)
+	}
+	if parsed.Error != nil {
+		return "", fmt.Errorf("chat completions error: %s", parsed.Error.Message)
+	}
+	if len(parsed.Choices) == 0 {
+		return "", fmt.Errorf("no choices returned")
+	}
+
+	return parsed.Choices[0].Message.Content, nil
+}
+
+// extractSceneChangeFrames pulls keyframes at scene-change boundaries and
+// returns them as base64-encoded JPEGs, earliest frame first. It
+// honors ctx cancellation so a canceled job kills ffmpeg instead of
+// letting it run to completion.
+func extractSceneChangeFrames(ctx context.Context, videoPath string) ([]string, error) {
+	tempDir, err := os.MkdirTemp("", "scene-frames-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tempDir)
+
+	cmd := exec.CommandContext(ctx, "ffmpeg",
+		"-i", videoPath,
+		"-vf", "select='gt(scene,0.4)'",
+		"-vsync", "vfr",
+		"-q:v", "2",
+		tempDir+"/frame-%04d.jpg",
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffmpeg error: %v, stderr: %s", err, stderr.String())
+	}
+
+	entries, err := os.ReadDir(tempDir)
+	if err != nil {
+		return nil, err
+	}
+
+	frames := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		data, err := os.ReadFile(tempDir + "/" + entry.Name())
+		if err != nil {
+			continue
+		}
+		frames = append(frames, base64.StdEncoding.EncodeToString(data))
+	}
+	return frames, nil
+}
+
+// transcribeAudio extracts the video's audio track and sends it to the
+// configured endpoint's Whisper-compatible /audio/transcriptions route,
+// so providers working from frames alone still get commentary/sideline
+// audio context.
+func (a *ChatCompletionAnalyzer) transcribeAudio(ctx context.Context, videoPath string) (string, error) {
+	audioFile, err := os.CreateTemp("", "audio-*.mp3")
+	if err != nil {
+		return "", err
+	}
+	audioPath := audioFile.Name()
+	audioFile.Close()
+	defer os.Remove(audioPath)
+
+	cmd := exec.CommandContext(ctx, "ffmpeg", "-i", videoPath, "-vn", "-ar", "16000", "-ac", "1", "-y", audioPath)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("ffmpeg audio extraction error: %v, stderr: %s", err, stderr.String())
+	}
+
+	f, err := os.Open(audioPath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", "audio.mp3")
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(part, f); err != nil {
+		return "", err
+	}
+	if err := writer.WriteField("model", a.transcriptionModel); err != nil {
+		return "", err
+	}
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.baseURL+"/audio/transcriptions", &body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	if a.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+a.apiKey)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error calling transcriptions endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var parsed struct {
+		Text  string `json:"text"`
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return "", fmt.Errorf("error decoding transcription response: %w", err)
+	}
+	if parsed.Error != nil {
+		return "", fmt.Errorf("transcription error: %s", parsed.Error.Message)
+	}
+
+	return parsed.Text, nil
+}
+
+func parseReport(jsonResponse string) (*Report, error) {
+	jsonResponse = strings.TrimSpace(jsonResponse)
+	jsonResponse = strings.TrimPrefix(jsonResponse, "```json")
+	jsonResponse = strings.TrimPrefix(jsonResponse, "```")
+	jsonResponse = strings.TrimSuffix(jsonResponse, "```")
+	jsonResponse = strings.TrimSpace(jsonResponse)
+
+	var report Report
+	if err := json.Unmarshal([]byte(jsonResponse), &report); err != nil {
+		return nil, fmt.Errorf("invalid JSON from analyzer: %w", err)
+	}
+	return &report, nil
+}
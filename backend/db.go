@@ -0,0 +1,42 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+
+	_ "modernc.org/sqlite"
+)
+
+// openDB opens (creating if necessary) the SQLite database that backs
+// the job queue, using the pure-Go modernc.org/sqlite driver so the
+// backend stays cgo-free. The path is configurable via DB_PATH so tests
+// and multi-instance deployments can point at their own file.
+func openDB() (*sql.DB, error) {
+	path := os.Getenv("DB_PATH")
+	if path == "" {
+		path = "glimpse.db"
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening database: %w", err)
+	}
+
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS jobs (
+			id         TEXT PRIMARY KEY,
+			status     TEXT NOT NULL,
+			video_path TEXT NOT NULL,
+			prompt     TEXT NOT NULL DEFAULT '',
+			result     TEXT,
+			error      TEXT,
+			created_at INTEGER NOT NULL,
+			updated_at INTEGER NOT NULL
+		)
+	`); err != nil {
+		return nil, fmt.Errorf("error creating jobs table: %w", err)
+	}
+
+	return db, nil
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// ingestEvent is a single progress update for a URL-ingest job, streamed
+// to clients over SSE.
+type ingestEvent struct {
+	Stage   string  `json:"stage"` // downloading | uploading | analyzing | done | error
+	Pct     float64 `json:"pct"`
+	Message string  `json:"message"`
+	Report  *Report `json:"report,omitempty"`
+}
+
+// ingestJob tracks one in-flight URL ingest and fans its progress out to
+// any number of SSE subscribers.
+type ingestJob struct {
+	mu          sync.Mutex
+	subscribers map[chan ingestEvent]struct{}
+	history     []ingestEvent
+}
+
+func newIngestJob() *ingestJob {
+	return &ingestJob{subscribers: make(map[chan ingestEvent]struct{})}
+}
+
+// publish records the event and forwards it to every live subscriber.
+// Subscribers are buffered, so a slow client drops events rather than
+// blocking the download/analysis pipeline.
+func (j *ingestJob) publish(event ingestEvent) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.history = append(j.history, event)
+	for ch := range j.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+func (j *ingestJob) subscribe() (chan ingestEvent, []ingestEvent) {
+	ch := make(chan ingestEvent, 16)
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.subscribers[ch] = struct{}{}
+	backlog := make([]ingestEvent, len(j.history))
+	copy(backlog, j.history)
+	return ch, backlog
+}
+
+func (j *ingestJob) unsubscribe(ch chan ingestEvent) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	delete(j.subscribers, ch)
+}
+
+var ingestJobs = struct {
+	mu   sync.Mutex
+	jobs map[string]*ingestJob
+}{jobs: make(map[string]*ingestJob)}
+
+// handleIngest pulls a video from a URL via yt-dlp and feeds it through
+// the same Analyzer pipeline as /upload. It returns immediately with a
+// job ID; progress is reported on GET /ingest/{jobId}/events.
+func handleIngest(apiKey string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			URL    string `json:"url"`
+			Prompt string `json:"prompt"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.URL == "" {
+			http.Error(w, "Missing or invalid url", http.StatusBadRequest)
+			return
+		}
+
+		jobID := uuid.NewString()
+		job := newIngestJob()
+		ingestJobs.mu.Lock()
+		ingestJobs.jobs[jobID] = job
+		ingestJobs.mu.Unlock()
+
+		go runIngestJob(job, apiKey, body.URL, body.Prompt)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"jobId": jobID})
+	}
+}
+
+// runIngestJob downloads the video with yt-dlp, reporting download
+// progress, then analyzes it and publishes the final report.
+func runIngestJob(job *ingestJob, apiKey, url, prompt string) {
+	ctx := context.Background()
+
+	tempFile, err := os.CreateTemp(os.TempDir(), "ingest-*.mp4")
+	if err != nil {
+		job.publish(ingestEvent{Stage: "error", Message: fmt.Sprintf("error creating temp file: %v", err)})
+		return
+	}
+	tempPath := tempFile.Name()
+	tempFile.Close()
+	defer os.Remove(tempPath)
+
+	job.publish(ingestEvent{Stage: "downloading", Pct: 0, Message: "Starting download"})
+
+	if err := downloadWithProgress(ctx, job, url, tempPath); err != nil {
+		job.publish(ingestEvent{Stage: "error", Message: fmt.Sprintf("yt-dlp error: %v", err)})
+		return
+	}
+
+	job.publish(ingestEvent{Stage: "uploading", Pct: 0, Message: "Uploading video for analysis"})
+
+	analyzer, err := NewAnalyzer(apiKey)
+	if err != nil {
+		job.publish(ingestEvent{Stage: "error", Message: err.Error()})
+		return
+	}
+
+	job.publish(ingestEvent{Stage: "analyzing", Pct: 0, Message: "Analyzing video"})
+
+	report, err := analyzer.Analyze(ctx, tempPath, prompt)
+	if err != nil {
+		job.publish(ingestEvent{Stage: "error", Message: fmt.Sprintf("error analyzing video: %v", err)})
+		return
+	}
+
+	job.publish(ingestEvent{Stage: "done", Pct: 100, Message: "Analysis complete", Report: report})
+}
+
+// ytdlpProgressRe matches the percentage emitted by our --progress-template.
+// _percent_str is right-justified by yt-dlp (e.g. "download:  42.3%"), so
+// whitespace between the colon and the digits must be allowed.
+var ytdlpProgressRe = regexp.MustCompile(`download:\s*([0-9.]+)%`)
+
+// downloadWithProgress invokes yt-dlp as a subprocess, capped at 720p,
+// and parses its --progress-template output into downloading events.
+func downloadWithProgress(ctx context.Context, job *ingestJob, url, outPath string) error {
+	cmd := exec.CommandContext(ctx, "yt-dlp",
+		"-f", "bestvideo[height<=720]+bestaudio/best[height<=720]",
+		"--newline",
+		"--progress-template", "download:%(progress._percent_str)s",
+		"-o", outPath,
+		url,
+	)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	cmd.Stderr = cmd.Stdout
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		match := ytdlpProgressRe.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		pct, err := strconv.ParseFloat(match[1], 64)
+		if err != nil {
+			continue
+		}
+		job.publish(ingestEvent{Stage: "downloading", Pct: pct, Message: "Downloading video"})
+	}
+
+	return cmd.Wait()
+}
+
+// handleIngestEvents streams progress for a job as Server-Sent Events
+// until the job reaches a terminal stage or the client disconnects.
+func handleIngestEvents() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jobID := chi.URLParam(r, "jobId")
+
+		ingestJobs.mu.Lock()
+		job := ingestJobs.jobs[jobID]
+		ingestJobs.mu.Unlock()
+		if job == nil {
+			http.Error(w, "Unknown job id", http.StatusNotFound)
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+
+		ch, backlog := job.subscribe()
+		defer job.unsubscribe(ch)
+
+		writeEvent := func(event ingestEvent) bool {
+			data, err := json.Marshal(event)
+			if err != nil {
+				return true
+			}
+			fmt.Fprintf(w, "data: %s\n\n", data)
+			flusher.Flush()
+			return event.Stage != "done" && event.Stage != "error"
+		}
+
+		for _, event := range backlog {
+			if !writeEvent(event) {
+				return
+			}
+		}
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case event := <-ch:
+				if !writeEvent(event) {
+					return
+				}
+			}
+		}
+	}
+}
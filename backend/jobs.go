@@ -0,0 +1,380 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// Job statuses. A job moves queued -> running -> (done | error | canceled).
+const (
+	jobStatusQueued   = "queued"
+	jobStatusRunning  = "running"
+	jobStatusDone     = "done"
+	jobStatusError    = "error"
+	jobStatusCanceled = "canceled"
+)
+
+// jobProgress is a single SSE update for a job. Unlike /ingest's
+// ingestEvent it carries a job status rather than a stage, and no pct.
+type jobProgress struct {
+	Status  string  `json:"status"`
+	Message string  `json:"message"`
+	Report  *Report `json:"report,omitempty"`
+}
+
+// JobManager owns the SQLite-backed job queue, the bounded worker pool
+// that drains it, and the in-memory bits (cancellation, SSE fan-out)
+// that don't need to survive a restart.
+type JobManager struct {
+	db       *sql.DB
+	analyzer Analyzer
+	queue    chan string
+
+	mu          sync.Mutex
+	cancelFuncs map[string]context.CancelFunc
+	subscribers map[string]map[chan jobProgress]struct{}
+}
+
+// NewJobManager opens the queue, starts MAX_WORKERS workers (default 4),
+// and requeues any job left queued or running from a previous process so
+// an unclean restart doesn't lose work.
+func NewJobManager(db *sql.DB, analyzer Analyzer) *JobManager {
+	workers := 4
+	if v := os.Getenv("MAX_WORKERS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			workers = n
+		}
+	}
+
+	jm := &JobManager{
+		db:          db,
+		analyzer:    analyzer,
+		queue:       make(chan string, 1024),
+		cancelFuncs: make(map[string]context.CancelFunc),
+		subscribers: make(map[string]map[chan jobProgress]struct{}),
+	}
+
+	for i := 0; i < workers; i++ {
+		go jm.worker()
+	}
+
+	jm.requeueIncomplete()
+
+	return jm
+}
+
+// requeueIncomplete pushes every job that was left queued or running by a
+// prior process back onto the queue so restarts don't strand work.
+func (jm *JobManager) requeueIncomplete() {
+	rows, err := jm.db.Query(`SELECT id FROM jobs WHERE status IN (?, ?)`, jobStatusQueued, jobStatusRunning)
+	if err != nil {
+		log.Printf("Error requeuing jobs: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			continue
+		}
+		jm.setStatus(id, jobStatusQueued, "", nil)
+		jm.queue <- id
+	}
+}
+
+// handleCreateJob saves the uploaded video, inserts a queued job row, and
+// returns its ID immediately without blocking on analysis.
+func (jm *JobManager) handleCreateJob() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, 200<<20)
+		if err := r.ParseMultipartForm(10 << 20); err != nil {
+			http.Error(w, "File too large or invalid multipart form", http.StatusBadRequest)
+			return
+		}
+
+		prompt := r.FormValue("prompt")
+
+		var videoPath string
+		if uploadID := r.FormValue("uploadId"); uploadID != "" {
+			path, err := completedUploadPath(uploadID)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			videoPath = path
+		} else {
+			file, _, err := r.FormFile("video")
+			if err != nil {
+				http.Error(w, "Error retrieving video file", http.StatusBadRequest)
+				return
+			}
+			defer file.Close()
+
+			dst, err := os.CreateTemp(os.TempDir(), "job-*.mp4")
+			if err != nil {
+				http.Error(w, "Error creating temporary file", http.StatusInternalServerError)
+				return
+			}
+			if _, err := io.Copy(dst, file); err != nil {
+				dst.Close()
+				http.Error(w, "Error saving file", http.StatusInternalServerError)
+				return
+			}
+			dst.Close()
+			videoPath = dst.Name()
+		}
+
+		id := uuid.NewString()
+		now := time.Now().Unix()
+		if _, err := jm.db.Exec(
+			`INSERT INTO jobs (id, status, video_path, prompt, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)`,
+			id, jobStatusQueued, videoPath, prompt, now, now,
+		); err != nil {
+			http.Error(w, fmt.Sprintf("Error creating job: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		jm.queue <- id
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"jobId": id})
+	}
+}
+
+// handleGetJob returns a job's current status and, once finished, its
+// result or error.
+func (jm *JobManager) handleGetJob() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+
+		var status, resultJSON, jobErr sql.NullString
+		err := jm.db.QueryRow(`SELECT status, result, error FROM jobs WHERE id = ?`, id).Scan(&status, &resultJSON, &jobErr)
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Unknown job id", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, fmt.Sprintf("Error reading job: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		resp := map[string]interface{}{"status": status.String}
+		if resultJSON.Valid && resultJSON.String != "" {
+			var report Report
+			if err := json.Unmarshal([]byte(resultJSON.String), &report); err == nil {
+				resp["result"] = report
+			}
+		}
+		if jobErr.Valid && jobErr.String != "" {
+			resp["error"] = jobErr.String
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// handleCancelJob cancels a running job's context, which propagates to
+// the ffmpeg and Gemini client calls it's waiting on.
+func (jm *JobManager) handleCancelJob() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+
+		jm.mu.Lock()
+		cancel, ok := jm.cancelFuncs[id]
+		jm.mu.Unlock()
+		if !ok {
+			http.Error(w, "Job is not running", http.StatusConflict)
+			return
+		}
+
+		cancel()
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// handleJobStream streams a job's progress as Server-Sent Events until it
+// reaches a terminal status or the client disconnects. Subscribing
+// happens before the initial DB read so a status change racing the
+// connection is still caught by the subscriber channel.
+func (jm *JobManager) handleJobStream() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+
+		ch := jm.subscribe(id)
+		defer jm.unsubscribe(id, ch)
+
+		snapshot, ok := jm.loadSnapshot(id)
+		if !ok {
+			http.Error(w, "Unknown job id", http.StatusNotFound)
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+
+		// Replay the job's current status immediately: a client that connects
+		// after the worker already finished would otherwise never see the
+		// terminal event and block forever.
+		if !writeJobEvent(w, flusher, snapshot) {
+			return
+		}
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case progress := <-ch:
+				if !writeJobEvent(w, flusher, progress) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// writeJobEvent writes one SSE frame and reports whether the stream
+// should continue (false for a terminal status or an encoding failure).
+func writeJobEvent(w http.ResponseWriter, flusher http.Flusher, progress jobProgress) bool {
+	data, err := json.Marshal(progress)
+	if err != nil {
+		return true
+	}
+	fmt.Fprintf(w, "data: %s\n\n", data)
+	flusher.Flush()
+	return progress.Status != jobStatusDone && progress.Status != jobStatusError && progress.Status != jobStatusCanceled
+}
+
+// loadSnapshot reads a job's current status/result/error from the
+// database as a jobProgress, for replay to newly connecting SSE clients.
+func (jm *JobManager) loadSnapshot(id string) (jobProgress, bool) {
+	var status, resultJSON, jobErr sql.NullString
+	if err := jm.db.QueryRow(`SELECT status, result, error FROM jobs WHERE id = ?`, id).Scan(&status, &resultJSON, &jobErr); err != nil {
+		return jobProgress{}, false
+	}
+
+	progress := jobProgress{Status: status.String}
+	if jobErr.Valid && jobErr.String != "" {
+		progress.Message = jobErr.String
+	}
+	if resultJSON.Valid && resultJSON.String != "" {
+		var report Report
+		if err := json.Unmarshal([]byte(resultJSON.String), &report); err == nil {
+			progress.Report = &report
+		}
+	}
+	return progress, true
+}
+
+func (jm *JobManager) subscribe(id string) chan jobProgress {
+	ch := make(chan jobProgress, 16)
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+	if jm.subscribers[id] == nil {
+		jm.subscribers[id] = make(map[chan jobProgress]struct{})
+	}
+	jm.subscribers[id][ch] = struct{}{}
+	return ch
+}
+
+func (jm *JobManager) unsubscribe(id string, ch chan jobProgress) {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+	delete(jm.subscribers[id], ch)
+}
+
+func (jm *JobManager) publish(id string, progress jobProgress) {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+	for ch := range jm.subscribers[id] {
+		select {
+		case ch <- progress:
+		default:
+		}
+	}
+}
+
+// worker pulls job IDs off the queue and runs them one at a time, forever.
+func (jm *JobManager) worker() {
+	for id := range jm.queue {
+		jm.runJob(id)
+	}
+}
+
+func (jm *JobManager) runJob(id string) {
+	var videoPath, prompt string
+	if err := jm.db.QueryRow(`SELECT video_path, prompt FROM jobs WHERE id = ?`, id).Scan(&videoPath, &prompt); err != nil {
+		log.Printf("Error loading job %s: %v", id, err)
+		return
+	}
+	defer os.Remove(videoPath)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	jm.mu.Lock()
+	jm.cancelFuncs[id] = cancel
+	jm.mu.Unlock()
+	defer func() {
+		jm.mu.Lock()
+		delete(jm.cancelFuncs, id)
+		jm.mu.Unlock()
+		cancel()
+	}()
+
+	jm.setStatus(id, jobStatusRunning, "", nil)
+	jm.publish(id, jobProgress{Status: jobStatusRunning, Message: "Analyzing video"})
+
+	report, err := jm.analyzer.Analyze(ctx, videoPath, prompt)
+	if errors.Is(ctx.Err(), context.Canceled) {
+		jm.setStatus(id, jobStatusCanceled, "", errors.New("canceled by client"))
+		jm.publish(id, jobProgress{Status: jobStatusCanceled, Message: "Canceled"})
+		return
+	}
+	if err != nil {
+		jm.setStatus(id, jobStatusError, "", err)
+		jm.publish(id, jobProgress{Status: jobStatusError, Message: err.Error()})
+		return
+	}
+
+	resultJSON, err := json.Marshal(report)
+	if err != nil {
+		jm.setStatus(id, jobStatusError, "", err)
+		jm.publish(id, jobProgress{Status: jobStatusError, Message: err.Error()})
+		return
+	}
+
+	jm.setStatus(id, jobStatusDone, string(resultJSON), nil)
+	jm.publish(id, jobProgress{Status: jobStatusDone, Message: "Analysis complete", Report: report})
+}
+
+func (jm *JobManager) setStatus(id, status, resultJSON string, jobErr error) {
+	errMsg := ""
+	if jobErr != nil {
+		errMsg = jobErr.Error()
+	}
+	if _, err := jm.db.Exec(
+		`UPDATE jobs SET status = ?, result = ?, error = ?, updated_at = ? WHERE id = ?`,
+		status, resultJSON, errMsg, time.Now().Unix(), id,
+	); err != nil {
+		log.Printf("Error updating job %s status: %v", id, err)
+	}
+}
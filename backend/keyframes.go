@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// keyframeCache holds the keyframe index for a video, keyed by its
+// content hash, so repeated screenshot requests on the same upload skip
+// re-probing.
+var keyframeCache = struct {
+	mu      sync.Mutex
+	indexes map[string][]float64
+}{indexes: make(map[string][]float64)}
+
+// handleKeyframes builds (or returns the cached) keyframe index for an
+// uploaded video as a sorted list of presentation timestamps, in seconds.
+func handleKeyframes() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, 200<<20)
+
+		if err := r.ParseMultipartForm(10 << 20); err != nil {
+			http.Error(w, "File too large or invalid multipart form", http.StatusBadRequest)
+			return
+		}
+
+		file, _, err := r.FormFile("video")
+		if err != nil {
+			http.Error(w, "Error retrieving video file", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+
+		tempFile, err := os.CreateTemp(os.TempDir(), "keyframes-*.mp4")
+		if err != nil {
+			http.Error(w, "Error creating temporary file", http.StatusInternalServerError)
+			return
+		}
+		tempPath := tempFile.Name()
+		defer os.Remove(tempPath)
+
+		if _, err := io.Copy(tempFile, file); err != nil {
+			tempFile.Close()
+			http.Error(w, "Error saving file", http.StatusInternalServerError)
+			return
+		}
+		tempFile.Close()
+
+		keyframes, err := getOrBuildKeyframeIndex(tempPath)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error building keyframe index: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keyframes": keyframes,
+		})
+	}
+}
+
+// getOrBuildKeyframeIndex returns the cached keyframe index for
+// videoPath's content, building and caching it via ffprobe on a miss.
+func getOrBuildKeyframeIndex(videoPath string) ([]float64, error) {
+	hash, err := contentHash(videoPath)
+	if err != nil {
+		return nil, err
+	}
+
+	keyframeCache.mu.Lock()
+	if cached, ok := keyframeCache.indexes[hash]; ok {
+		keyframeCache.mu.Unlock()
+		return cached, nil
+	}
+	keyframeCache.mu.Unlock()
+
+	keyframes, err := buildKeyframeIndex(videoPath)
+	if err != nil {
+		return nil, err
+	}
+
+	keyframeCache.mu.Lock()
+	keyframeCache.indexes[hash] = keyframes
+	keyframeCache.mu.Unlock()
+
+	return keyframes, nil
+}
+
+// buildKeyframeIndex runs ffprobe to list every keyframe's presentation
+// timestamp in the video, sorted ascending.
+func buildKeyframeIndex(videoPath string) ([]float64, error) {
+	cmd := exec.Command("ffprobe",
+		"-v", "error",
+		"-select_streams", "v",
+		"-show_frames",
+		"-skip_frame", "nokey",
+		"-show_entries", "frame=pkt_pts_time,pict_type",
+		"-of", "json",
+		videoPath,
+	)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffprobe error: %v, stderr: %s", err, stderr.String())
+	}
+
+	var parsed struct {
+		Frames []struct {
+			PktPtsTime string `json:"pkt_pts_time"`
+			PictType   string `json:"pict_type"`
+		} `json:"frames"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse ffprobe output: %v", err)
+	}
+
+	keyframes := make([]float64, 0, len(parsed.Frames))
+	for _, f := range parsed.Frames {
+		if f.PktPtsTime == "" {
+			continue
+		}
+		ts, err := strconv.ParseFloat(f.PktPtsTime, 64)
+		if err != nil {
+			continue
+		}
+		keyframes = append(keyframes, ts)
+	}
+	sort.Float64s(keyframes)
+
+	return keyframes, nil
+}
+
+// nearestKeyframe returns the keyframe timestamp closest to ts. It
+// assumes keyframes is sorted ascending, as returned by buildKeyframeIndex.
+func nearestKeyframe(keyframes []float64, ts float64) float64 {
+	if len(keyframes) == 0 {
+		return ts
+	}
+
+	i := sort.SearchFloat64s(keyframes, ts)
+	if i == 0 {
+		return keyframes[0]
+	}
+	if i == len(keyframes) {
+		return keyframes[len(keyframes)-1]
+	}
+
+	before := keyframes[i-1]
+	after := keyframes[i]
+	if ts-before <= after-ts {
+		return before
+	}
+	return after
+}
+
+// contentHash computes a content-based cache key for a video file.
+func contentHash(videoPath string) (string, error) {
+	f, err := os.Open(videoPath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
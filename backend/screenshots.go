@@ -71,19 +71,35 @@ func handleExtractScreenshots() http.HandlerFunc {
 		}
 		tempFile.Close()
 
-		log.Printf("Processing video: %s, extracting %d screenshots", tempPath, len(timestamps))
+		snapToKeyframe := r.FormValue("snap") == "keyframe"
 
-		// Always convert video to standard format for reliable extraction
-		// This ensures fragmented MP4s (from YouTube/streaming) work correctly
-		log.Printf("Converting video to standard format for reliable extraction...")
-		convertedPath, err := convertEntireVideo(tempPath)
+		log.Printf("Processing video: %s, extracting %d screenshots (snap=%v)", tempPath, len(timestamps), snapToKeyframe)
+
+		var keyframes []float64
 		videoToUse := tempPath
-		if err != nil {
-			log.Printf("Video conversion failed, trying original: %v", err)
-		} else {
-			videoToUse = convertedPath
-			defer os.Remove(convertedPath) // Clean up converted file
-			log.Printf("Video converted successfully: %s", convertedPath)
+		if snapToKeyframe {
+			// Snapping lets us use the fast before-input -ss seek path (which is
+			// byte-accurate only on keyframes), skipping the full-video
+			// conversion that the default path below runs first.
+			keyframes, err = getOrBuildKeyframeIndex(tempPath)
+			if err != nil {
+				log.Printf("Keyframe index build failed, falling back to conversion pipeline: %v", err)
+				snapToKeyframe = false
+			}
+		}
+
+		if !snapToKeyframe {
+			// Always convert video to standard format for reliable extraction
+			// This ensures fragmented MP4s (from YouTube/streaming) work correctly
+			log.Printf("Converting video to standard format for reliable extraction...")
+			convertedPath, convertErr := convertEntireVideo(tempPath)
+			if convertErr != nil {
+				log.Printf("Video conversion failed, trying original: %v", convertErr)
+			} else {
+				videoToUse = convertedPath
+				defer os.Remove(convertedPath) // Clean up converted file
+				log.Printf("Video converted successfully: %s", convertedPath)
+			}
 		}
 
 		// Get video duration to validate timestamps
@@ -115,8 +131,16 @@ func handleExtractScreenshots() http.HandlerFunc {
 				continue
 			}
 
-			screenshot, err := extractFrameDirect(videoToUse, validTimestamps[validIndex])
+			target := validTimestamps[validIndex]
 			validIndex++
+
+			var screenshot string
+			if snapToKeyframe {
+				snapped := nearestKeyframe(keyframes, target)
+				screenshot, err = extractFrameFastSeek(videoToUse, snapped)
+			} else {
+				screenshot, err = extractFrameDirect(videoToUse, target)
+			}
 			if err != nil {
 				log.Printf("Error extracting frame at %.2fs: %v", timestamp, err)
 				screenshots[i] = "" // Empty string for failed extractions
@@ -189,6 +213,38 @@ func extractFrameDirect(videoPath string, timestamp float64) (string, error) {
 	return "data:image/jpeg;base64," + base64Image, nil
 }
 
+// extractFrameFastSeek extracts a frame using the before-input -ss seek,
+// which is byte-accurate (no decoding from the preceding keyframe) but
+// only lands exactly on a keyframe. Callers must snap the timestamp to
+// one first via nearestKeyframe.
+func extractFrameFastSeek(videoPath string, timestamp float64) (string, error) {
+	cmd := exec.Command("ffmpeg",
+		"-ss", fmt.Sprintf("%.3f", timestamp),
+		"-i", videoPath,
+		"-vframes", "1",
+		"-f", "image2pipe",
+		"-vcodec", "mjpeg",
+		"-q:v", "2",
+		"-y",
+		"pipe:1",
+	)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("ffmpeg error: %v, stderr: %s", err, stderr.String())
+	}
+
+	if stdout.Len() == 0 {
+		return "", fmt.Errorf("no output from ffmpeg")
+	}
+
+	base64Image := base64.StdEncoding.EncodeToString(stdout.Bytes())
+	return "data:image/jpeg;base64," + base64Image, nil
+}
+
 // Convert video to standard format first, then extract frame
 func extractFrameWithConversion(videoPath string, timestamp float64) (string, error) {
 	// Create temp file for converted video
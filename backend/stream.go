@@ -0,0 +1,506 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// segmentDuration is the target length, in seconds, of each HLS segment.
+const segmentDuration = 3.0
+
+// maxSeekAheadChunks is how far past the worker's furthest produced segment
+// a requested chunk may be before it's treated as a distant forward seek
+// and the worker is restarted from the new position instead of being left
+// to transcode every intermediate segment.
+const maxSeekAheadChunks = 15
+
+// streamIdleTimeout is how long a Manager may go without a request (master
+// playlist, quality playlist or segment) before its ffmpeg workers are
+// killed and its cache is reaped.
+const streamIdleTimeout = 2 * time.Minute
+
+// qualityLadder maps a quality label to the ffmpeg scale height used when
+// transcoding that variant. Only variants that fit within the source
+// resolution are offered in the master playlist.
+var qualityLadder = []struct {
+	name   string
+	height int
+}{
+	{"1080p", 1080},
+	{"720p", 720},
+	{"480p", 480},
+	{"360p", 360},
+}
+
+// probeResult holds the ffprobe output we need to plan chunk boundaries and
+// the quality ladder for a video.
+type probeResult struct {
+	DurationSeconds float64
+	Width           int
+	Height          int
+}
+
+// Stream tracks segment production for a single quality variant of a video.
+// At most one ffmpeg worker runs per Stream at a time; it transcodes
+// forward from workerFrom and produced is updated as segments land on
+// disk, so sequential chunk requests within the same run are served
+// from cache instead of spawning a new worker per chunk.
+type Stream struct {
+	quality string
+	height  int
+
+	mu         sync.Mutex
+	produced   map[int]bool
+	cmd        *exec.Cmd
+	workerFrom int
+	furthest   int
+}
+
+// Manager owns everything needed to serve one uploaded video as adaptive
+// HLS: the source path, its probe result, and one Stream per quality
+// variant that fits within the source resolution.
+type Manager struct {
+	id        string
+	videoPath string
+	cacheDir  string
+	probe     probeResult
+	chunks    int
+
+	mu         sync.Mutex
+	streams    map[string]*Stream
+	lastAccess time.Time
+}
+
+// streamRegistry is the process-wide set of active Managers, keyed by
+// video ID. A background reaper periodically removes idle entries.
+var streamRegistry = struct {
+	mu       sync.Mutex
+	managers map[string]*Manager
+}{managers: make(map[string]*Manager)}
+
+func init() {
+	go reapIdleStreams()
+}
+
+// reapIdleStreams kills ffmpeg workers and drops the cache for any Manager
+// that hasn't served any request in streamIdleTimeout.
+func reapIdleStreams() {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+	for range ticker.C {
+		streamRegistry.mu.Lock()
+		for id, mgr := range streamRegistry.managers {
+			mgr.mu.Lock()
+			idle := time.Since(mgr.lastAccess)
+			mgr.mu.Unlock()
+			if idle < streamIdleTimeout {
+				continue
+			}
+			log.Printf("Reaping idle stream manager %s (idle %s)", id, idle)
+			mgr.close()
+			delete(streamRegistry.managers, id)
+		}
+		streamRegistry.mu.Unlock()
+	}
+}
+
+// close kills any in-flight ffmpeg workers and removes the segment cache.
+func (m *Manager) close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, s := range m.streams {
+		s.mu.Lock()
+		if s.cmd != nil && s.cmd.Process != nil {
+			_ = s.cmd.Process.Kill()
+		}
+		s.mu.Unlock()
+	}
+	os.RemoveAll(m.cacheDir)
+}
+
+// handleStreamIngest accepts an uploaded video, probes it, and creates a
+// Manager keyed by a new video ID so the client can start requesting HLS
+// segments for it.
+func handleStreamIngest() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, 200<<20)
+
+		if err := r.ParseMultipartForm(10 << 20); err != nil {
+			http.Error(w, "File too large or invalid multipart form", http.StatusBadRequest)
+			return
+		}
+
+		file, _, err := r.FormFile("video")
+		if err != nil {
+			http.Error(w, "Error retrieving video file", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+
+		id := uuid.NewString()
+		cacheDir := filepath.Join(os.TempDir(), "glimpse-stream-"+id)
+		if err := os.MkdirAll(cacheDir, 0o755); err != nil {
+			http.Error(w, "Error creating stream cache", http.StatusInternalServerError)
+			return
+		}
+
+		videoPath := filepath.Join(cacheDir, "source.mp4")
+		dst, err := os.Create(videoPath)
+		if err != nil {
+			http.Error(w, "Error saving video", http.StatusInternalServerError)
+			return
+		}
+		if _, err := dst.ReadFrom(file); err != nil {
+			dst.Close()
+			os.RemoveAll(cacheDir)
+			http.Error(w, "Error saving video", http.StatusInternalServerError)
+			return
+		}
+		dst.Close()
+
+		probe, err := probeVideo(videoPath)
+		if err != nil {
+			os.RemoveAll(cacheDir)
+			http.Error(w, fmt.Sprintf("Error probing video: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		mgr := &Manager{
+			id:         id,
+			videoPath:  videoPath,
+			cacheDir:   cacheDir,
+			probe:      probe,
+			chunks:     int(probe.DurationSeconds/segmentDuration) + 1,
+			streams:    make(map[string]*Stream),
+			lastAccess: time.Now(),
+		}
+
+		streamRegistry.mu.Lock()
+		streamRegistry.managers[id] = mgr
+		streamRegistry.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":              id,
+			"durationSeconds": probe.DurationSeconds,
+			"chunks":          mgr.chunks,
+		})
+	}
+}
+
+// handleStreamManifest serves the master .m3u8 playlist for a video,
+// listing only the quality variants that fit within the source resolution.
+func handleStreamManifest() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+		mgr := getManager(id)
+		if mgr == nil {
+			http.Error(w, "Unknown stream id", http.StatusNotFound)
+			return
+		}
+
+		var buf bytes.Buffer
+		buf.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n")
+		for _, q := range qualityLadder {
+			if q.height > mgr.probe.Height {
+				continue
+			}
+			bandwidth := q.height * 5000 // rough bits-per-second estimate
+			buf.WriteString(fmt.Sprintf("#EXT-X-STREAM-INF:BANDWIDTH=%d,RESOLUTION=%dx%d\n", bandwidth, q.height*16/9, q.height))
+			buf.WriteString(fmt.Sprintf("%s/playlist.m3u8\n", q.name))
+		}
+
+		w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+		w.Write(buf.Bytes())
+	}
+}
+
+// handleQualityPlaylist serves the per-quality .m3u8 listing every segment
+// in the stream, independent of whether it has been produced yet.
+func handleQualityPlaylist() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+		mgr := getManager(id)
+		if mgr == nil {
+			http.Error(w, "Unknown stream id", http.StatusNotFound)
+			return
+		}
+
+		var buf bytes.Buffer
+		buf.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:3\n#EXT-X-PLAYLIST-TYPE:VOD\n")
+		for i := 0; i < mgr.chunks; i++ {
+			// Relative to this playlist's own URL (/stream/{id}/{quality}/playlist.m3u8),
+			// so the segment URI must not repeat the quality segment again.
+			buf.WriteString(fmt.Sprintf("#EXTINF:%.3f,\nsegment%d.ts\n", segmentDuration, i))
+		}
+		buf.WriteString("#EXT-X-ENDLIST\n")
+
+		w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+		w.Write(buf.Bytes())
+	}
+}
+
+// handleStreamSegment serves a single TS segment, transcoding it on demand
+// if no worker has produced it yet. If the requested chunk is behind the
+// point the worker started from, or more than maxSeekAheadChunks past the
+// furthest segment it has written (a seek), the in-flight worker is killed
+// and restarted from the new position.
+func handleStreamSegment() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+		quality := chi.URLParam(r, "quality")
+		chunk, err := strconv.Atoi(chi.URLParam(r, "chunk"))
+		if err != nil {
+			http.Error(w, "Invalid chunk index", http.StatusBadRequest)
+			return
+		}
+
+		mgr := getManager(id)
+		if mgr == nil {
+			http.Error(w, "Unknown stream id", http.StatusNotFound)
+			return
+		}
+
+		segmentPath, err := mgr.ensureSegment(quality, chunk)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error producing segment: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "video/mp2t")
+		http.ServeFile(w, r, segmentPath)
+	}
+}
+
+func getManager(id string) *Manager {
+	streamRegistry.mu.Lock()
+	mgr := streamRegistry.managers[id]
+	streamRegistry.mu.Unlock()
+	if mgr != nil {
+		mgr.mu.Lock()
+		mgr.lastAccess = time.Now()
+		mgr.mu.Unlock()
+	}
+	return mgr
+}
+
+// ensureSegment returns the path to the requested chunk's TS file,
+// transcoding it (and restarting the worker if the client seeked) if it
+// hasn't been produced yet.
+func (m *Manager) ensureSegment(quality string, chunk int) (string, error) {
+	height := 0
+	for _, q := range qualityLadder {
+		if q.name == quality {
+			height = q.height
+		}
+	}
+	if height == 0 {
+		return "", fmt.Errorf("unknown quality %q", quality)
+	}
+
+	m.mu.Lock()
+	stream, ok := m.streams[quality]
+	if !ok {
+		stream = &Stream{quality: quality, height: height, produced: make(map[int]bool), workerFrom: -1, furthest: -1}
+		m.streams[quality] = stream
+	}
+	m.mu.Unlock()
+
+	qualityDir := filepath.Join(m.cacheDir, quality)
+	if err := os.MkdirAll(qualityDir, 0o755); err != nil {
+		return "", err
+	}
+	segmentPath := filepath.Join(qualityDir, fmt.Sprintf("segment%d.ts", chunk))
+
+	stream.mu.Lock()
+	if stream.produced[chunk] {
+		stream.mu.Unlock()
+		return segmentPath, nil
+	}
+
+	// The running worker only ever moves forward, so it can only ever reach
+	// chunks at or after the point it was started from. Anything else - no
+	// worker yet, a seek behind it, or a seek far enough ahead that we'd
+	// rather re-seek ffmpeg than wait for it to transcode every
+	// intermediate segment - needs a restart.
+	if stream.cmd == nil || chunk < stream.workerFrom || chunk > stream.furthest+maxSeekAheadChunks {
+		if stream.cmd != nil && stream.cmd.Process != nil {
+			_ = stream.cmd.Process.Kill()
+		}
+
+		startTime := float64(chunk) * segmentDuration
+		cmd := exec.Command("ffmpeg",
+			"-ss", fmt.Sprintf("%.3f", startTime),
+			"-i", m.videoPath,
+			"-vf", fmt.Sprintf("scale=-2:%d", height),
+			"-c:v", "libx264",
+			"-force_key_frames", "expr:gte(t,n_forced*3)",
+			"-hls_time", "3",
+			"-hls_segment_type", "mpegts",
+			"-hls_segment_filename", filepath.Join(qualityDir, "segment%d.ts"),
+			"-start_number", strconv.Itoa(chunk),
+			"-f", "hls",
+			filepath.Join(qualityDir, "playlist.m3u8"),
+		)
+		if err := cmd.Start(); err != nil {
+			stream.mu.Unlock()
+			return "", fmt.Errorf("error starting ffmpeg: %w", err)
+		}
+		stream.cmd = cmd
+		stream.workerFrom = chunk
+		stream.furthest = chunk - 1
+		go watchSegments(stream, qualityDir, chunk, cmd)
+	}
+	stream.mu.Unlock()
+
+	return waitForSegment(stream, segmentPath, chunk)
+}
+
+// watchSegments polls qualityDir while cmd runs, marking every segment it
+// finds as produced so requests for chunks the worker has already passed
+// are served without spawning another ffmpeg run.
+func watchSegments(stream *Stream, qualityDir string, startChunk int, cmd *exec.Cmd) {
+	done := make(chan struct{})
+	var waitErr error
+	go func() {
+		waitErr = cmd.Wait()
+		close(done)
+	}()
+
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			markProducedSegments(stream, qualityDir, startChunk, false)
+		case <-done:
+			// A worker that was killed (seek restart or reap) may have left
+			// its last segment half-written, so only a clean exit counts.
+			markProducedSegments(stream, qualityDir, startChunk, waitErr == nil)
+			stream.mu.Lock()
+			if stream.cmd == cmd {
+				stream.cmd = nil
+			}
+			stream.mu.Unlock()
+			return
+		}
+	}
+}
+
+// markProducedSegments records segmentN.ts files written to qualityDir (at
+// or after startChunk) as produced. ffmpeg's HLS muxer writes each segment
+// in place rather than to a temp file, so the highest-numbered segment on
+// disk may still be growing; it's only marked produced once the next
+// segment has appeared (proof the muxer moved past it) or the worker has
+// exited cleanly (processExited), at which point everything left on disk
+// is final.
+func markProducedSegments(stream *Stream, qualityDir string, startChunk int, processExited bool) {
+	entries, err := os.ReadDir(qualityDir)
+	if err != nil {
+		return
+	}
+
+	present := make(map[int]bool, len(entries))
+	for _, entry := range entries {
+		var n int
+		if _, err := fmt.Sscanf(entry.Name(), "segment%d.ts", &n); err != nil {
+			continue
+		}
+		present[n] = true
+	}
+
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+	for n := range present {
+		if n < startChunk {
+			continue
+		}
+		if n > stream.furthest {
+			stream.furthest = n
+		}
+		if processExited || present[n+1] {
+			stream.produced[n] = true
+		}
+	}
+}
+
+// waitForSegment blocks until the worker produces segmentPath or gives up
+// on it (a later, non-overlapping seek restarted the worker elsewhere).
+func waitForSegment(stream *Stream, segmentPath string, chunk int) (string, error) {
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		stream.mu.Lock()
+		produced := stream.produced[chunk]
+		stillRelevant := stream.cmd != nil && stream.workerFrom <= chunk
+		stream.mu.Unlock()
+
+		if produced {
+			return segmentPath, nil
+		}
+		if !stillRelevant {
+			return "", fmt.Errorf("segment %d was superseded by a later seek", chunk)
+		}
+		if time.Now().After(deadline) {
+			return "", fmt.Errorf("timed out waiting for segment %d", chunk)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// probeVideo runs ffprobe once to get the duration and resolution needed
+// to plan chunk boundaries and the quality ladder.
+func probeVideo(videoPath string) (probeResult, error) {
+	cmd := exec.Command("ffprobe",
+		"-v", "error",
+		"-select_streams", "v:0",
+		"-show_entries", "stream=width,height",
+		"-show_entries", "format=duration",
+		"-of", "json",
+		videoPath,
+	)
+
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return probeResult{}, fmt.Errorf("ffprobe error: %v", err)
+	}
+
+	var parsed struct {
+		Streams []struct {
+			Width  int `json:"width"`
+			Height int `json:"height"`
+		} `json:"streams"`
+		Format struct {
+			Duration string `json:"duration"`
+		} `json:"format"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &parsed); err != nil {
+		return probeResult{}, fmt.Errorf("failed to parse ffprobe output: %v", err)
+	}
+	if len(parsed.Streams) == 0 {
+		return probeResult{}, fmt.Errorf("no video stream found")
+	}
+
+	duration, err := strconv.ParseFloat(parsed.Format.Duration, 64)
+	if err != nil {
+		return probeResult{}, fmt.Errorf("failed to parse duration: %v", err)
+	}
+
+	return probeResult{
+		DurationSeconds: duration,
+		Width:           parsed.Streams[0].Width,
+		Height:          parsed.Streams[0].Height,
+	}, nil
+}
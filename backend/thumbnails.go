@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// spriteTileWidth is the width, in pixels, each sampled frame is scaled
+// to before being tiled into the sprite sheet. Height is derived from
+// the source aspect ratio so thumbnails aren't stretched.
+const spriteTileWidth = 160
+
+// spriteMaxTiles caps the sprite grid so a long video still produces a
+// reasonably sized sheet; the sample interval grows to fit.
+const spriteMaxTiles = 200
+
+// spriteColumns is fixed; rows grow to fit however many tiles the
+// duration and spriteMaxTiles work out to.
+const spriteColumns = 10
+
+// handleCreateThumbnails builds a WebVTT + JPEG sprite-sheet pair for
+// hover-scrubbing: one frame every N seconds, tiled into a grid via a
+// single ffmpeg invocation, with a .vtt mapping timestamp ranges to
+// sprite regions.
+func handleCreateThumbnails() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, 200<<20)
+		if err := r.ParseMultipartForm(10 << 20); err != nil {
+			http.Error(w, "File too large or invalid multipart form", http.StatusBadRequest)
+			return
+		}
+
+		file, _, err := r.FormFile("video")
+		if err != nil {
+			http.Error(w, "Error retrieving video file", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+
+		tempFile, err := os.CreateTemp(os.TempDir(), "thumbsrc-*.mp4")
+		if err != nil {
+			http.Error(w, "Error creating temporary file", http.StatusInternalServerError)
+			return
+		}
+		tempPath := tempFile.Name()
+		defer os.Remove(tempPath)
+
+		if _, err := io.Copy(tempFile, file); err != nil {
+			tempFile.Close()
+			http.Error(w, "Error saving file", http.StatusInternalServerError)
+			return
+		}
+		tempFile.Close()
+
+		probe, err := probeVideo(tempPath)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error probing video: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		id := uuid.NewString()
+		cacheDir := filepath.Join(os.TempDir(), "glimpse-cache-"+id)
+		if err := os.MkdirAll(cacheDir, 0o755); err != nil {
+			http.Error(w, "Error creating cache directory", http.StatusInternalServerError)
+			return
+		}
+
+		interval := probe.DurationSeconds / spriteMaxTiles
+		if interval < 1 {
+			interval = 1
+		}
+		tileCount := int(probe.DurationSeconds/interval) + 1
+		rows := (tileCount + spriteColumns - 1) / spriteColumns
+		if rows < 1 {
+			rows = 1
+		}
+
+		// Same height ffmpeg picks for scale=W:-1: aspect-preserving,
+		// rounded to the nearest pixel, not forced even.
+		tileHeight := int(math.Round(float64(spriteTileWidth*probe.Height) / float64(probe.Width)))
+
+		spritePath := filepath.Join(cacheDir, "sprite.jpg")
+		if err := generateSprite(tempPath, spritePath, interval, rows); err != nil {
+			os.RemoveAll(cacheDir)
+			http.Error(w, fmt.Sprintf("Error generating sprite: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		vttPath := filepath.Join(cacheDir, "thumbs.vtt")
+		if err := writeSpriteVTT(vttPath, probe.DurationSeconds, interval, spriteColumns, spriteTileWidth, tileHeight); err != nil {
+			os.RemoveAll(cacheDir)
+			http.Error(w, fmt.Sprintf("Error writing VTT: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"id":        id,
+			"spriteUrl": "/cache/" + id + "/sprite.jpg",
+			"vttUrl":    "/cache/" + id + "/thumbs.vtt",
+		})
+	}
+}
+
+// generateSprite samples one frame every interval seconds and tiles them
+// into a spriteColumns x rows grid in a single ffmpeg invocation.
+func generateSprite(videoPath, outPath string, interval float64, rows int) error {
+	cmd := exec.Command("ffmpeg",
+		"-i", videoPath,
+		"-vf", fmt.Sprintf("fps=1/%.3f,scale=%d:-1,tile=%dx%d", interval, spriteTileWidth, spriteColumns, rows),
+		"-q:v", "4",
+		"-y",
+		outPath,
+	)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ffmpeg error: %v, stderr: %s", err, stderr.String())
+	}
+	return nil
+}
+
+// writeSpriteVTT emits a WebVTT file mapping each interval-second range
+// to its tile's xywh region in the sprite sheet, in row-major order.
+func writeSpriteVTT(vttPath string, duration, interval float64, columns, tileWidth, tileHeight int) error {
+	var buf bytes.Buffer
+	buf.WriteString("WEBVTT\n\n")
+
+	tile := 0
+	for start := 0.0; start < duration; start += interval {
+		end := start + interval
+		if end > duration {
+			end = duration
+		}
+
+		col := tile % columns
+		row := tile / columns
+		x := col * tileWidth
+		y := row * tileHeight
+
+		buf.WriteString(fmt.Sprintf("%s --> %s\n", formatVTTTimestamp(start), formatVTTTimestamp(end)))
+		buf.WriteString(fmt.Sprintf("sprite.jpg#xywh=%d,%d,%d,%d\n\n", x, y, tileWidth, tileHeight))
+		tile++
+	}
+
+	return os.WriteFile(vttPath, buf.Bytes(), 0o644)
+}
+
+func formatVTTTimestamp(seconds float64) string {
+	hours := int(seconds) / 3600
+	minutes := (int(seconds) % 3600) / 60
+	secs := int(seconds) % 60
+	millis := int((seconds - float64(int(seconds))) * 1000)
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", hours, minutes, secs, millis)
+}
+
+// handleCacheFile serves the sprite and VTT files generated for a
+// thumbnails request (or any other cache-directory-backed feature) out
+// of the shared temp cache directory layout.
+func handleCacheFile() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+		name := chi.URLParam(r, "*")
+		if name == "" || filepath.Base(name) != name {
+			http.Error(w, "Invalid cache file path", http.StatusBadRequest)
+			return
+		}
+
+		path := filepath.Join(os.TempDir(), "glimpse-cache-"+id, name)
+		http.ServeFile(w, r, path)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// uploadSession is one tus-style resumable upload: a destination file and
+// how many bytes of it have been written so far. Sessions are in-memory
+// only; the partial file on disk is what actually survives a dropped
+// connection, which is all a client needs to resume.
+type uploadSession struct {
+	mu     sync.Mutex
+	path   string
+	length int64
+	offset int64
+}
+
+var uploadSessions = struct {
+	mu       sync.Mutex
+	sessions map[string]*uploadSession
+}{sessions: make(map[string]*uploadSession)}
+
+// handleCreateUpload starts a resumable upload per the tus creation
+// extension: the client declares the total length up front via
+// Upload-Length, and we hand back a URL to PATCH bytes into.
+func handleCreateUpload() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+		if err != nil || length <= 0 {
+			http.Error(w, "Missing or invalid Upload-Length header", http.StatusBadRequest)
+			return
+		}
+
+		id := uuid.NewString()
+		dst, err := os.CreateTemp(os.TempDir(), "upload-*.mp4")
+		if err != nil {
+			http.Error(w, "Error creating upload file", http.StatusInternalServerError)
+			return
+		}
+		dst.Close()
+
+		session := &uploadSession{path: dst.Name(), length: length}
+		uploadSessions.mu.Lock()
+		uploadSessions.sessions[id] = session
+		uploadSessions.mu.Unlock()
+
+		w.Header().Set("Tus-Resumable", "1.0.0")
+		w.Header().Set("Location", "/uploads/"+id)
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+// handleUploadOffset answers the tus HEAD check: how many bytes has the
+// server actually received, so the client knows where to resume from.
+func handleUploadOffset() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session := getUploadSession(w, r)
+		if session == nil {
+			return
+		}
+
+		session.mu.Lock()
+		defer session.mu.Unlock()
+
+		w.Header().Set("Tus-Resumable", "1.0.0")
+		w.Header().Set("Upload-Offset", strconv.FormatInt(session.offset, 10))
+		w.Header().Set("Upload-Length", strconv.FormatInt(session.length, 10))
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// handleUploadChunk appends a chunk to the upload, per the tus core
+// PATCH protocol: the client must send the offset it believes is
+// current, and a mismatch means the client is out of sync and must HEAD
+// first to find the real offset.
+func handleUploadChunk() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session := getUploadSession(w, r)
+		if session == nil {
+			return
+		}
+
+		clientOffset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+		if err != nil {
+			http.Error(w, "Missing or invalid Upload-Offset header", http.StatusBadRequest)
+			return
+		}
+
+		session.mu.Lock()
+		defer session.mu.Unlock()
+
+		if clientOffset != session.offset {
+			http.Error(w, fmt.Sprintf("Offset mismatch: server has %d", session.offset), http.StatusConflict)
+			return
+		}
+
+		f, err := os.OpenFile(session.path, os.O_WRONLY, 0o644)
+		if err != nil {
+			http.Error(w, "Error opening upload file", http.StatusInternalServerError)
+			return
+		}
+		defer f.Close()
+
+		if _, err := f.Seek(session.offset, io.SeekStart); err != nil {
+			http.Error(w, "Error seeking upload file", http.StatusInternalServerError)
+			return
+		}
+
+		written, err := io.Copy(f, http.MaxBytesReader(w, r.Body, session.length-session.offset))
+		// Count bytes already on disk even if the connection dropped mid-chunk,
+		// so a HEAD reports them and the client resumes after them.
+		session.offset += written
+		if err != nil {
+			http.Error(w, "Error writing upload chunk", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Tus-Resumable", "1.0.0")
+		w.Header().Set("Upload-Offset", strconv.FormatInt(session.offset, 10))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func getUploadSession(w http.ResponseWriter, r *http.Request) *uploadSession {
+	id := chi.URLParam(r, "id")
+	uploadSessions.mu.Lock()
+	session := uploadSessions.sessions[id]
+	uploadSessions.mu.Unlock()
+	if session == nil {
+		http.Error(w, "Unknown upload id", http.StatusNotFound)
+		return nil
+	}
+	return session
+}
+
+// completedUploadPath returns the destination file for a finished upload,
+// or an error if the upload is unknown or still in progress.
+func completedUploadPath(id string) (string, error) {
+	uploadSessions.mu.Lock()
+	session := uploadSessions.sessions[id]
+	uploadSessions.mu.Unlock()
+	if session == nil {
+		return "", fmt.Errorf("unknown upload id %q", id)
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	if session.offset < session.length {
+		return "", fmt.Errorf("upload %q is incomplete (%d/%d bytes)", id, session.offset, session.length)
+	}
+	return session.path, nil
+}